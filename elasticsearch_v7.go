@@ -7,10 +7,10 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"net/http"
 	"net/url"
 	"os"
 	"strconv"
-	"strings"
 	"time"
 
 	"github.com/aaronland/go-pagination"
@@ -21,6 +21,7 @@ import (
 	"github.com/elastic/go-elasticsearch/v7/estransport"
 	"github.com/elastic/go-elasticsearch/v7/esutil"
 	"github.com/sfomuseum/go-libraryofcongress-database"
+	"github.com/sfomuseum/go-libraryofcongress-database-elasticsearch/internal"
 	"github.com/sfomuseum/go-timings"
 )
 
@@ -31,6 +32,7 @@ type ElasticsearchV7Database struct {
 	logger   *log.Logger
 	workers  int
 	query_by string
+	health   *internal.HealthChecker
 }
 
 func init() {
@@ -64,6 +66,20 @@ func NewElasticsearchV7Database(ctx context.Context, uri string) (database.Libra
 	q_query_by := q.Get("query-by")
 	q_create_index := q.Get("create-index")
 
+	healthcheck_interval := internal.DefaultHealthCheckInterval
+	str_healthcheck_interval := q.Get("healthcheck-interval")
+
+	if str_healthcheck_interval != "" {
+
+		secs, err := strconv.Atoi(str_healthcheck_interval)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse ?healthcheck-interval= parameter, %w", err)
+		}
+
+		healthcheck_interval = time.Duration(secs) * time.Second
+	}
+
 	if str_workers != "" {
 
 		w, err := strconv.Atoi(str_workers)
@@ -100,22 +116,43 @@ func NewElasticsearchV7Database(ctx context.Context, uri string) (database.Libra
 
 	if q_query_by != "" {
 
-		switch q_query_by {
-		case "text", "label":
-			// pass
-		default:
-			return nil, fmt.Errorf("Invalid ?search-by= parameter")
+		valid_query_by := false
+
+		for _, mode := range internal.QueryByModes {
+			if q_query_by == mode {
+				valid_query_by = true
+				break
+			}
+		}
+
+		if !valid_query_by {
+			return nil, fmt.Errorf("Invalid ?query-by= parameter")
 		}
 
 		query_by = q_query_by
 	}
 
+	transport_opts, err := internal.ParseTransportOptions(q)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse transport options, %w", err)
+	}
+
+	var es_addresses []string
+
+	if es_endpoint != "" {
+		es_addresses = []string{es_endpoint}
+	}
+
 	retry := backoff.NewExponentialBackOff()
 
 	es_cfg := es.Config{
-		Addresses: []string{
-			es_endpoint,
-		},
+		Addresses: es_addresses,
+
+		Username: transport_opts.Username,
+		Password: transport_opts.Password,
+		APIKey:   transport_opts.APIKey,
+		CloudID:  transport_opts.CloudID,
 
 		RetryOnStatus: []int{502, 503, 504, 429},
 		RetryBackoff: func(i int) time.Duration {
@@ -127,6 +164,18 @@ func NewElasticsearchV7Database(ctx context.Context, uri string) (database.Libra
 		MaxRetries: 5,
 	}
 
+	tls_cfg, err := transport_opts.NewTLSClientConfig()
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to derive TLS client config, %w", err)
+	}
+
+	if tls_cfg != nil {
+		es_cfg.Transport = &http.Transport{
+			TLSClientConfig: tls_cfg,
+		}
+	}
+
 	if debug {
 
 		elasticsearch_logger := &estransport.TextLogger{
@@ -146,19 +195,61 @@ func NewElasticsearchV7Database(ctx context.Context, uri string) (database.Libra
 
 	if create_index {
 
-		_, err = es_client.Indices.Create(es_index)
+		mapping_body, err := internal.LoadMapping(ctx, q.Get("mapping"))
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to load mapping, %w", err)
+		}
+
+		create_rsp, err := es_client.Indices.Create(
+			es_index,
+			es_client.Indices.Create.WithContext(ctx),
+			es_client.Indices.Create.WithBody(bytes.NewReader(mapping_body)),
+		)
 
 		if err != nil {
 			return nil, fmt.Errorf("Failed to create index, %w", err)
 		}
+
+		defer create_rsp.Body.Close()
+
+		if create_rsp.IsError() {
+
+			body, _ := io.ReadAll(create_rsp.Body)
+
+			if !internal.IsResourceAlreadyExistsError(body) {
+				return nil, fmt.Errorf("Failed to create index, %s", string(body))
+			}
+		}
 	}
 
+	ping_func := func(ping_ctx context.Context) error {
+
+		rsp, err := es_client.Ping(es_client.Ping.WithContext(ping_ctx))
+
+		if err != nil {
+			return err
+		}
+
+		defer rsp.Body.Close()
+
+		if rsp.IsError() {
+			return fmt.Errorf("Ping failed with status %s", rsp.Status())
+		}
+
+		return nil
+	}
+
+	health := internal.NewHealthChecker(healthcheck_interval, ping_func)
+	health.Start(context.Background())
+
 	elasticsearch_db := &ElasticsearchV7Database{
 		client:   es_client,
 		index:    es_index,
 		workers:  workers,
 		logger:   logger,
 		query_by: query_by,
+		health:   health,
 	}
 
 	return elasticsearch_db, nil
@@ -235,8 +326,44 @@ func NewElasticsearchV7Database(ctx context.Context, uri string) (database.Libra
 	*/
 }
 
+// Ping performs an immediate health check against the cluster, independent
+// of the background health checker started in NewElasticsearchV7Database.
+func (elasticsearch_db *ElasticsearchV7Database) Ping(ctx context.Context) error {
+
+	rsp, err := elasticsearch_db.client.Ping(elasticsearch_db.client.Ping.WithContext(ctx))
+
+	if err != nil {
+		return err
+	}
+
+	defer rsp.Body.Close()
+
+	if rsp.IsError() {
+		return fmt.Errorf("Ping failed with status %s", rsp.Status())
+	}
+
+	return nil
+}
+
+// Available reports the result of the most recent background health check.
+func (elasticsearch_db *ElasticsearchV7Database) Available() bool {
+	return elasticsearch_db.health.Available()
+}
+
+// Close stops the background health check goroutine. It does not close the
+// underlying ES client, which does not own any long-lived resources of its
+// own.
+func (elasticsearch_db *ElasticsearchV7Database) Close(ctx context.Context) error {
+	elasticsearch_db.health.Stop()
+	return nil
+}
+
 func (elasticsearch_db *ElasticsearchV7Database) Index(ctx context.Context, sources []*database.Source, monitor timings.Monitor) error {
 
+	if !elasticsearch_db.Available() {
+		return internal.ErrBackendUnavailable
+	}
+
 	bi_cfg := esutil.BulkIndexerConfig{
 		Index:         elasticsearch_db.index,
 		Client:        elasticsearch_db.client,
@@ -282,12 +409,7 @@ func (elasticsearch_db *ElasticsearchV7Database) indexSource(ctx context.Context
 
 	cb := func(ctx context.Context, row map[string]string) error {
 
-		doc := map[string]string{
-			"id":     row["id"],
-			"label":  row["label"],
-			"source": src.Label,
-		}
-
+		doc := internal.NewDoc(row, src)
 		doc_id := row["id"]
 
 		enc_doc, err := json.Marshal(doc)
@@ -333,13 +455,14 @@ func (elasticsearch_db *ElasticsearchV7Database) indexSource(ctx context.Context
 
 func (elasticsearch_db *ElasticsearchV7Database) Query(ctx context.Context, q string, pg_opts pagination.Options) ([]*database.QueryResult, pagination.Results, error) {
 
-	// q = fmt.Sprintf(`{"query": { "term": { "search": { "value": "%s" } } } }`, q)
+	if !elasticsearch_db.Available() {
+		return nil, nil, internal.ErrBackendUnavailable
+	}
+
+	enc_query, err := internal.MarshalQuery(elasticsearch_db.query_by, q)
 
-	switch elasticsearch_db.query_by {
-	case "text":
-		q = fmt.Sprintf(`{"query": { "match_phrase": { "search": "%s" } } }`, q)
-	default:
-		q = fmt.Sprintf(`{"query": { "match_phrase": { "label.keyword": "%s" } } }`, q)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to build query, %w", err)
 	}
 
 	// START OF From and Size don't seem to be doing anything...
@@ -350,7 +473,7 @@ func (elasticsearch_db *ElasticsearchV7Database) Query(ctx context.Context, q st
 		Index: []string{
 			elasticsearch_db.index,
 		},
-		Body: strings.NewReader(q),
+		Body: bytes.NewReader(enc_query),
 		Size: &size,
 	}
 
@@ -375,10 +498,7 @@ func (elasticsearch_db *ElasticsearchV7Database) Query(ctx context.Context, q st
 		return nil, nil, fmt.Errorf("Request failed with response: %s", rsp.Status())
 	}
 
-	var query_rsp *QueryResponse
-
-	dec := json.NewDecoder(rsp.Body)
-	err = dec.Decode(&query_rsp)
+	query_rsp, err := internal.DecodeQueryResponse(rsp.Body)
 
 	if err != nil {
 		return nil, nil, fmt.Errorf("Failed to decode response, %w", err)
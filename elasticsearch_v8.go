@@ -0,0 +1,443 @@
+package elasticsearch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aaronland/go-pagination"
+	"github.com/aaronland/go-pagination/countable"
+	"github.com/cenkalti/backoff/v4"
+	elastictransport "github.com/elastic/elastic-transport-go/v8/elastictransport"
+	es8 "github.com/elastic/go-elasticsearch/v8"
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+	"github.com/elastic/go-elasticsearch/v8/esutil"
+	"github.com/sfomuseum/go-libraryofcongress-database"
+	"github.com/sfomuseum/go-libraryofcongress-database-elasticsearch/internal"
+	"github.com/sfomuseum/go-timings"
+)
+
+type ElasticsearchV8Database struct {
+	database.LibraryOfCongressDatabase
+	client   *es8.Client
+	index    string
+	logger   *log.Logger
+	workers  int
+	query_by string
+	health   *internal.HealthChecker
+}
+
+func init() {
+	ctx := context.Background()
+	database.RegisterLibraryOfCongressDatabase(ctx, "elasticsearchv8", NewElasticsearchV8Database)
+}
+
+func NewElasticsearchV8Database(ctx context.Context, uri string) (database.LibraryOfCongressDatabase, error) {
+
+	u, err := url.Parse(uri)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse URI, %w", err)
+	}
+
+	logger := log.New(io.Discard, "", 0)
+
+	workers := 10
+
+	debug := false
+	query_by := "label"
+
+	create_index := false
+
+	q := u.Query()
+
+	es_endpoint := q.Get("endpoint")
+	es_index := q.Get("index")
+	str_workers := q.Get("workers")
+	q_debug := q.Get("debug")
+	q_query_by := q.Get("query-by")
+	q_create_index := q.Get("create-index")
+
+	healthcheck_interval := internal.DefaultHealthCheckInterval
+	str_healthcheck_interval := q.Get("healthcheck-interval")
+
+	if str_healthcheck_interval != "" {
+
+		secs, err := strconv.Atoi(str_healthcheck_interval)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse ?healthcheck-interval= parameter, %w", err)
+		}
+
+		healthcheck_interval = time.Duration(secs) * time.Second
+	}
+
+	if str_workers != "" {
+
+		w, err := strconv.Atoi(str_workers)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse workers, %w", err)
+		}
+
+		workers = w
+	}
+
+	if q_debug != "" {
+
+		v, err := strconv.ParseBool(q_debug)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse ?debug= parameter, %w", err)
+		}
+
+		debug = v
+		logger = log.New(os.Stdout, "", 0)
+	}
+
+	if q_create_index != "" {
+
+		v, err := strconv.ParseBool(q_create_index)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse ?create-index= parameter, %w", err)
+		}
+
+		create_index = v
+	}
+
+	if q_query_by != "" {
+
+		valid_query_by := false
+
+		for _, mode := range internal.QueryByModes {
+			if q_query_by == mode {
+				valid_query_by = true
+				break
+			}
+		}
+
+		if !valid_query_by {
+			return nil, fmt.Errorf("Invalid ?query-by= parameter")
+		}
+
+		query_by = q_query_by
+	}
+
+	transport_opts, err := internal.ParseTransportOptions(q)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse transport options, %w", err)
+	}
+
+	var es_addresses []string
+
+	if es_endpoint != "" {
+		es_addresses = []string{es_endpoint}
+	}
+
+	retry := backoff.NewExponentialBackOff()
+
+	es_cfg := es8.Config{
+		Addresses: es_addresses,
+
+		Username: transport_opts.Username,
+		Password: transport_opts.Password,
+		APIKey:   transport_opts.APIKey,
+		CloudID:  transport_opts.CloudID,
+
+		RetryOnStatus: []int{502, 503, 504, 429},
+		RetryBackoff: func(i int) time.Duration {
+			if i == 1 {
+				retry.Reset()
+			}
+			return retry.NextBackOff()
+		},
+		MaxRetries: 5,
+	}
+
+	tls_cfg, err := transport_opts.NewTLSClientConfig()
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to derive TLS client config, %w", err)
+	}
+
+	if tls_cfg != nil {
+		es_cfg.Transport = &http.Transport{
+			TLSClientConfig: tls_cfg,
+		}
+	}
+
+	if debug {
+
+		elasticsearch_logger := &elastictransport.TextLogger{
+			Output:             os.Stdout,
+			EnableRequestBody:  true,
+			EnableResponseBody: true,
+		}
+
+		es_cfg.Logger = elasticsearch_logger
+	}
+
+	es_client, err := es8.NewClient(es_cfg)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create ES client, %w", err)
+	}
+
+	if create_index {
+
+		mapping_body, err := internal.LoadMapping(ctx, q.Get("mapping"))
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to load mapping, %w", err)
+		}
+
+		create_rsp, err := es_client.Indices.Create(
+			es_index,
+			es_client.Indices.Create.WithContext(ctx),
+			es_client.Indices.Create.WithBody(bytes.NewReader(mapping_body)),
+		)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to create index, %w", err)
+		}
+
+		defer create_rsp.Body.Close()
+
+		if create_rsp.IsError() {
+
+			body, _ := io.ReadAll(create_rsp.Body)
+
+			if !internal.IsResourceAlreadyExistsError(body) {
+				return nil, fmt.Errorf("Failed to create index, %s", string(body))
+			}
+		}
+	}
+
+	ping_func := func(ping_ctx context.Context) error {
+
+		rsp, err := es_client.Ping(es_client.Ping.WithContext(ping_ctx))
+
+		if err != nil {
+			return err
+		}
+
+		defer rsp.Body.Close()
+
+		if rsp.IsError() {
+			return fmt.Errorf("Ping failed with status %s", rsp.Status())
+		}
+
+		return nil
+	}
+
+	health := internal.NewHealthChecker(healthcheck_interval, ping_func)
+	health.Start(context.Background())
+
+	elasticsearch_db := &ElasticsearchV8Database{
+		client:   es_client,
+		index:    es_index,
+		workers:  workers,
+		logger:   logger,
+		query_by: query_by,
+		health:   health,
+	}
+
+	return elasticsearch_db, nil
+}
+
+// Ping performs an immediate health check against the cluster, independent
+// of the background health checker started in NewElasticsearchV8Database.
+func (elasticsearch_db *ElasticsearchV8Database) Ping(ctx context.Context) error {
+
+	rsp, err := elasticsearch_db.client.Ping(elasticsearch_db.client.Ping.WithContext(ctx))
+
+	if err != nil {
+		return err
+	}
+
+	defer rsp.Body.Close()
+
+	if rsp.IsError() {
+		return fmt.Errorf("Ping failed with status %s", rsp.Status())
+	}
+
+	return nil
+}
+
+// Available reports the result of the most recent background health check.
+func (elasticsearch_db *ElasticsearchV8Database) Available() bool {
+	return elasticsearch_db.health.Available()
+}
+
+// Close stops the background health check goroutine. It does not close the
+// underlying ES client, which does not own any long-lived resources of its
+// own.
+func (elasticsearch_db *ElasticsearchV8Database) Close(ctx context.Context) error {
+	elasticsearch_db.health.Stop()
+	return nil
+}
+
+func (elasticsearch_db *ElasticsearchV8Database) Index(ctx context.Context, sources []*database.Source, monitor timings.Monitor) error {
+
+	if !elasticsearch_db.Available() {
+		return internal.ErrBackendUnavailable
+	}
+
+	bi_cfg := esutil.BulkIndexerConfig{
+		Index:         elasticsearch_db.index,
+		Client:        elasticsearch_db.client,
+		NumWorkers:    elasticsearch_db.workers,
+		FlushInterval: 30 * time.Second,
+		OnError: func(ctx context.Context, err error) {
+			elasticsearch_db.logger.Printf("ELASTICSEARCH bulk indexer reported an error: %v\n", err)
+		},
+		OnFlushEnd: func(context.Context) {
+			elasticsearch_db.logger.Printf("ELASTICSEARCH bulk indexer flush end")
+		},
+	}
+
+	indexer, err := esutil.NewBulkIndexer(bi_cfg)
+
+	if err != nil {
+		return fmt.Errorf("Failed to create bulk indexer, %w", err)
+	}
+
+	for _, src := range sources {
+
+		err := elasticsearch_db.indexSource(ctx, indexer, src, monitor)
+
+		if err != nil {
+			return fmt.Errorf("Failed to index %s, %v", src.Label, err)
+		}
+	}
+
+	err = indexer.Close(ctx)
+
+	if err != nil {
+		return fmt.Errorf("Failed to close indexer, %w", err)
+	}
+
+	stats := indexer.Stats()
+	elasticsearch_db.logger.Printf("Stats %v\n", stats)
+
+	return nil
+}
+
+func (elasticsearch_db *ElasticsearchV8Database) indexSource(ctx context.Context, indexer esutil.BulkIndexer, src *database.Source, monitor timings.Monitor) error {
+
+	cb := func(ctx context.Context, row map[string]string) error {
+
+		doc := internal.NewDoc(row, src)
+		doc_id := row["id"]
+
+		enc_doc, err := json.Marshal(doc)
+
+		if err != nil {
+			return fmt.Errorf("Failed to marshal %s, %v", doc_id, err)
+		}
+
+		bulk_item := esutil.BulkIndexerItem{
+			Action:     "index",
+			DocumentID: doc_id,
+			Body:       bytes.NewReader(enc_doc),
+
+			OnSuccess: func(ctx context.Context, item esutil.BulkIndexerItem, res esutil.BulkIndexerResponseItem) {
+				// pass
+			},
+
+			OnFailure: func(ctx context.Context, item esutil.BulkIndexerItem, res esutil.BulkIndexerResponseItem, err error) {
+				if err != nil {
+					log.Printf("ERROR: Failed to index %s, %s", doc_id, err)
+				} else {
+					log.Printf("ERROR: Failed to index %s, %s: %s", doc_id, res.Error.Type, res.Error.Reason)
+				}
+			},
+		}
+
+		err = indexer.Add(ctx, bulk_item)
+
+		if err != nil {
+			log.Printf("Failed to schedule %s, %v", doc_id, err)
+			return nil
+		}
+
+		go monitor.Signal(ctx)
+		return nil
+	}
+
+	return src.Index(ctx, cb)
+}
+
+func (elasticsearch_db *ElasticsearchV8Database) Query(ctx context.Context, q string, pg_opts pagination.Options) ([]*database.QueryResult, pagination.Results, error) {
+
+	if !elasticsearch_db.Available() {
+		return nil, nil, internal.ErrBackendUnavailable
+	}
+
+	enc_query, err := internal.MarshalQuery(elasticsearch_db.query_by, q)
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to build query, %w", err)
+	}
+
+	size := int(pg_opts.PerPage())
+
+	req := esapi.SearchRequest{
+		Index: []string{
+			elasticsearch_db.index,
+		},
+		Body: bytes.NewReader(enc_query),
+		Size: &size,
+	}
+
+	pg := int(countable.PageFromOptions(pg_opts))
+
+	if pg > 1 {
+		from := (pg - 1) * size
+		req.From = &from
+	}
+
+	rsp, err := req.Do(ctx, elasticsearch_db.client)
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to perform query, %q", err)
+	}
+
+	defer rsp.Body.Close()
+
+	if rsp.IsError() {
+		return nil, nil, fmt.Errorf("Request failed with response: %s", rsp.Status())
+	}
+
+	query_rsp, err := internal.DecodeQueryResponse(rsp.Body)
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to decode response, %w", err)
+	}
+
+	total := query_rsp.Hits.Total.Value
+
+	results := make([]*database.QueryResult, len(query_rsp.Hits.Results))
+
+	for idx, r := range query_rsp.Hits.Results {
+		results[idx] = r.Result
+	}
+
+	pg_results, err := countable.NewResultsFromCountWithOptions(pg_opts, int64(total))
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to create response pagination, %w", err)
+	}
+
+	return results, pg_results, nil
+}
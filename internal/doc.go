@@ -0,0 +1,19 @@
+package internal
+
+import (
+	"github.com/sfomuseum/go-libraryofcongress-database"
+)
+
+// NewDoc derives the document that is indexed for a single LoC row. It is
+// shared by the v7 and v8 drivers so that the shape of an indexed document
+// can't drift between the two.
+func NewDoc(row map[string]string, src *database.Source) map[string]string {
+
+	doc := map[string]string{
+		"id":     row["id"],
+		"label":  row["label"],
+		"source": src.Label,
+	}
+
+	return doc
+}
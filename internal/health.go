@@ -0,0 +1,100 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrBackendUnavailable is returned by Index and Query when the health
+// checker has determined that the Elasticsearch cluster is not reachable,
+// rather than letting the caller block on the client's own retry/backoff
+// storm.
+var ErrBackendUnavailable = errors.New("Elasticsearch backend is unavailable")
+
+// DefaultHealthCheckInterval is the interval between health checks when
+// ?healthcheck-interval= is not specified in a driver's connection URI.
+const DefaultHealthCheckInterval = 30 * time.Second
+
+// HealthChecker polls a cluster on a fixed interval, using a driver-supplied
+// ping function, and exposes the result behind a mutex so that Index and
+// Query can cheaply check availability without making a request of their
+// own.
+type HealthChecker struct {
+	mu        sync.RWMutex
+	available bool
+	ping      func(ctx context.Context) error
+	interval  time.Duration
+	done      chan struct{}
+}
+
+// NewHealthChecker returns a *HealthChecker that calls ping on interval. The
+// checker is assumed available until its first check completes.
+func NewHealthChecker(interval time.Duration, ping func(ctx context.Context) error) *HealthChecker {
+
+	if interval <= 0 {
+		interval = DefaultHealthCheckInterval
+	}
+
+	hc := &HealthChecker{
+		available: true,
+		ping:      ping,
+		interval:  interval,
+		done:      make(chan struct{}),
+	}
+
+	return hc
+}
+
+// Start performs an initial check and then launches the background ticker
+// goroutine that checks again every hc.interval, until Stop is called.
+func (hc *HealthChecker) Start(ctx context.Context) {
+
+	hc.check(ctx)
+
+	go func() {
+
+		ticker := time.NewTicker(hc.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-hc.done:
+				return
+			case <-ticker.C:
+				hc.check(ctx)
+			}
+		}
+	}()
+}
+
+func (hc *HealthChecker) check(ctx context.Context) {
+
+	err := hc.ping(ctx)
+
+	hc.mu.Lock()
+	hc.available = (err == nil)
+	hc.mu.Unlock()
+}
+
+// Available returns the result of the most recent health check.
+func (hc *HealthChecker) Available() bool {
+
+	hc.mu.RLock()
+	defer hc.mu.RUnlock()
+
+	return hc.available
+}
+
+// Stop terminates the background ticker goroutine started by Start. It is
+// safe to call Stop more than once.
+func (hc *HealthChecker) Stop() {
+
+	select {
+	case <-hc.done:
+		// already stopped
+	default:
+		close(hc.done)
+	}
+}
@@ -0,0 +1,118 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// DefaultMapping is the mapping and analysis chain applied to new indices
+// when no ?mapping= override is given. It tunes the "label" field for LoC
+// data: a plain keyword sub-field for exact matching, a search_as_you_type
+// sub-field for autocomplete, and an analyzer chain (ICU folding, lowercase,
+// edge-ngram) so prefix and fuzzy queries behave sensibly.
+//
+// The analyzer chain uses icu_folding, which ships in the analysis-icu
+// plugin rather than Elasticsearch core. A cluster without that plugin
+// installed will fail ?create-index=true with "Unknown token filter type
+// [icu_folding]" - that failure is not swallowed the way
+// IsResourceAlreadyExistsError swallows an existing index, since it is a
+// real configuration problem the operator needs to fix (install the plugin,
+// or supply a ?mapping= override without icu_folding).
+const DefaultMapping = `{
+  "settings": {
+    "index": {
+      "max_ngram_diff": 19
+    },
+    "analysis": {
+      "filter": {
+        "loc_edge_ngram_filter": {
+          "type": "edge_ngram",
+          "min_gram": 1,
+          "max_gram": 20
+        }
+      },
+      "analyzer": {
+        "loc_label_analyzer": {
+          "type": "custom",
+          "tokenizer": "standard",
+          "filter": [ "icu_folding", "lowercase", "loc_edge_ngram_filter" ]
+        },
+        "loc_label_search_analyzer": {
+          "type": "custom",
+          "tokenizer": "standard",
+          "filter": [ "icu_folding", "lowercase" ]
+        }
+      }
+    }
+  },
+  "mappings": {
+    "properties": {
+      "id": { "type": "keyword" },
+      "source": { "type": "keyword" },
+      "label": {
+        "type": "text",
+        "analyzer": "loc_label_analyzer",
+        "search_analyzer": "loc_label_search_analyzer",
+        "fields": {
+          "keyword": { "type": "keyword" },
+          "search_as_you_type": { "type": "search_as_you_type" }
+        }
+      }
+    }
+  }
+}`
+
+// LoadMapping returns the body to send when creating an index. If uri is
+// empty the built-in DefaultMapping is returned. Otherwise uri is treated as
+// either an HTTP(S) URL or a path on disk containing the mapping JSON.
+func LoadMapping(ctx context.Context, uri string) ([]byte, error) {
+
+	if uri == "" {
+		return []byte(DefaultMapping), nil
+	}
+
+	if strings.HasPrefix(uri, "http://") || strings.HasPrefix(uri, "https://") {
+
+		req, err := http.NewRequestWithContext(ctx, "GET", uri, nil)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to create request for %s, %w", uri, err)
+		}
+
+		rsp, err := http.DefaultClient.Do(req)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to fetch %s, %w", uri, err)
+		}
+
+		defer rsp.Body.Close()
+
+		body, err := io.ReadAll(rsp.Body)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read response body for %s, %w", uri, err)
+		}
+
+		return body, nil
+	}
+
+	body, err := os.ReadFile(uri)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read %s, %w", uri, err)
+	}
+
+	return body, nil
+}
+
+// IsResourceAlreadyExistsError returns true if body is an Elasticsearch error
+// response reporting that the index already exists, so callers can treat
+// ?create-index=true as idempotent rather than fatal.
+func IsResourceAlreadyExistsError(body []byte) bool {
+	return bytes.Contains(body, []byte("resource_already_exists_exception"))
+}
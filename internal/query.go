@@ -0,0 +1,111 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// QueryByModes are the valid values for the ?query-by= connection parameter,
+// shared by the v7 and v8 drivers so the set of supported modes can't drift
+// between them.
+var QueryByModes = []string{
+	"text",
+	"label",
+	"fuzzy",
+	"prefix",
+	"autocomplete",
+}
+
+// BuildQuery derives the Elasticsearch query body (as a map, ready to be
+// passed to json.Marshal) for searching q under query_by. Building the query
+// this way - rather than interpolating q directly in to a JSON string -
+// ensures labels containing quotes or backslashes are encoded correctly.
+func BuildQuery(query_by string, q string) (map[string]any, error) {
+
+	var query map[string]any
+
+	switch query_by {
+
+	case "text":
+		query = map[string]any{
+			"match_phrase": map[string]any{
+				"search": q,
+			},
+		}
+
+	case "label":
+		query = map[string]any{
+			"match_phrase": map[string]any{
+				"label.keyword": q,
+			},
+		}
+
+	case "fuzzy":
+		query = map[string]any{
+			"match": map[string]any{
+				"label": map[string]any{
+					"query":         q,
+					"fuzziness":     "AUTO",
+					"prefix_length": 1,
+				},
+			},
+		}
+
+	case "prefix":
+		// "label" is already indexed through loc_label_analyzer, which
+		// applies edge_ngram at index time - see DefaultMapping. A plain
+		// match query is all that's needed for prefix matching; layering
+		// match_bool_prefix's own prefix expansion on top of an
+		// already-edge-ngrammed field would double-expand short queries.
+		query = map[string]any{
+			"match": map[string]any{
+				"label": q,
+			},
+		}
+
+	case "autocomplete":
+		// "label" is excluded from the fields list for the same reason
+		// "prefix" above doesn't use match_bool_prefix against it - it is
+		// already edge-ngrammed at index time, so including it here would
+		// double-expand against the root field.
+		query = map[string]any{
+			"multi_match": map[string]any{
+				"query": q,
+				"type":  "bool_prefix",
+				"fields": []string{
+					"label.search_as_you_type",
+					"label.search_as_you_type._2gram",
+					"label.search_as_you_type._3gram",
+				},
+			},
+		}
+
+	default:
+		return nil, fmt.Errorf("Invalid query-by mode '%s'", query_by)
+	}
+
+	body := map[string]any{
+		"query": query,
+	}
+
+	return body, nil
+}
+
+// MarshalQuery builds the query body for q under query_by and encodes it as
+// JSON.
+func MarshalQuery(query_by string, q string) ([]byte, error) {
+
+	body, err := BuildQuery(query_by, q)
+
+	if err != nil {
+		return nil, err
+	}
+
+	enc_body, err := json.Marshal(body)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to marshal query, %w", err)
+	}
+
+	return enc_body, nil
+}
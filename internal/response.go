@@ -0,0 +1,51 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/sfomuseum/go-libraryofcongress-database"
+)
+
+// QueryResponse is the shared envelope for decoding search responses returned
+// by both the v7 and v8 Elasticsearch drivers. The two clients emit JSON
+// bodies that are wire-compatible for the fields we care about, so a single
+// type is decoded regardless of which driver issued the request.
+type QueryResponse struct {
+	ScrollID string            `json:"_scroll_id"`
+	Hits     QueryResponseHits `json:"hits"`
+}
+
+type QueryResponseHits struct {
+	Total   QueryResponseTotal `json:"total"`
+	Results []QueryResponseHit `json:"hits"`
+}
+
+type QueryResponseTotal struct {
+	Value    int    `json:"value"`
+	Relation string `json:"relation"`
+}
+
+type QueryResponseHit struct {
+	Index  string                `json:"_index"`
+	ID     string                `json:"_id"`
+	Score  float64               `json:"_score"`
+	Sort   []any                 `json:"sort"`
+	Result *database.QueryResult `json:"_source"`
+}
+
+// DecodeQueryResponse decodes r in to a *QueryResponse.
+func DecodeQueryResponse(r io.Reader) (*QueryResponse, error) {
+
+	var rsp *QueryResponse
+
+	dec := json.NewDecoder(r)
+	err := dec.Decode(&rsp)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to decode query response, %w", err)
+	}
+
+	return rsp, nil
+}
@@ -0,0 +1,100 @@
+package internal
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+)
+
+// TransportOptions are the connection credentials and TLS settings that can
+// be passed to either the v7 or v8 driver's connection URI. They are parsed
+// once here so that the two drivers can't drift in how they interpret the
+// same query parameters.
+type TransportOptions struct {
+	Username           string
+	Password           string
+	APIKey             string
+	CloudID            string
+	CACert             []byte
+	InsecureSkipVerify bool
+}
+
+// ParseTransportOptions derives a *TransportOptions from q, the query
+// parameters of a driver's connection URI.
+func ParseTransportOptions(q url.Values) (*TransportOptions, error) {
+
+	username := q.Get("username")
+	password := q.Get("password")
+	api_key := q.Get("api-key")
+	cloud_id := q.Get("cloud-id")
+	ca_cert := q.Get("ca-cert")
+	q_insecure := q.Get("insecure-skip-verify")
+
+	if api_key != "" && username != "" {
+		return nil, fmt.Errorf("Can not specify both ?api-key= and ?username=")
+	}
+
+	if cloud_id != "" && q.Get("endpoint") != "" {
+		return nil, fmt.Errorf("Can not specify both ?cloud-id= and ?endpoint=")
+	}
+
+	opts := &TransportOptions{
+		Username: username,
+		Password: password,
+		APIKey:   api_key,
+		CloudID:  cloud_id,
+	}
+
+	if ca_cert != "" {
+
+		body, err := os.ReadFile(ca_cert)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read ?ca-cert= parameter, %w", err)
+		}
+
+		opts.CACert = body
+	}
+
+	if q_insecure != "" {
+
+		v, err := strconv.ParseBool(q_insecure)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse ?insecure-skip-verify= parameter, %w", err)
+		}
+
+		opts.InsecureSkipVerify = v
+	}
+
+	return opts, nil
+}
+
+// NewTLSClientConfig derives a *tls.Config from opts, or nil if opts does not
+// require any non-default TLS behaviour.
+func (opts *TransportOptions) NewTLSClientConfig() (*tls.Config, error) {
+
+	if len(opts.CACert) == 0 && !opts.InsecureSkipVerify {
+		return nil, nil
+	}
+
+	tls_cfg := &tls.Config{
+		InsecureSkipVerify: opts.InsecureSkipVerify,
+	}
+
+	if len(opts.CACert) != 0 {
+
+		pool := x509.NewCertPool()
+
+		if !pool.AppendCertsFromPEM(opts.CACert) {
+			return nil, fmt.Errorf("Failed to parse ?ca-cert= parameter")
+		}
+
+		tls_cfg.RootCAs = pool
+	}
+
+	return tls_cfg, nil
+}
@@ -0,0 +1,313 @@
+package elasticsearch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/sfomuseum/go-libraryofcongress-database"
+	"github.com/sfomuseum/go-libraryofcongress-database-elasticsearch/internal"
+)
+
+// IterableDatabase is implemented by any database.LibraryOfCongressDatabase
+// that can stream every result matching a query, bypassing the
+// index.max_result_window limit that from/size pagination is subject to.
+//
+// database.LibraryOfCongressDatabase itself is defined upstream in
+// github.com/sfomuseum/go-libraryofcongress-database, which this repo does
+// not own and cannot add an Iterate method to. IterableDatabase is a
+// deliberate, narrower substitute scoped to this repo: callers that need to
+// export an entire dataset should type-assert a database.LibraryOfCongressDatabase
+// against IterableDatabase rather than calling Iterate directly. Adding
+// Iterate to the upstream interface is a separate, upstream change.
+type IterableDatabase interface {
+	Iterate(ctx context.Context, q string, fn func(*database.QueryResult) error) error
+}
+
+const iterate_page_size = 1000
+const iterate_keep_alive = "1m"
+
+// Iterate walks every result matching q, yielding each to fn in turn. It
+// prefers the point-in-time plus search-after APIs (available on ES 7.10
+// and up); if opening a point-in-time fails - for example because the
+// cluster predates 7.10 - it falls back to the scroll API. Iterate stops as
+// soon as fn returns an error and returns an error wrapping it, and honours
+// ctx cancellation between pages.
+func (elasticsearch_db *ElasticsearchV7Database) Iterate(ctx context.Context, q string, fn func(*database.QueryResult) error) error {
+
+	if !elasticsearch_db.Available() {
+		return internal.ErrBackendUnavailable
+	}
+
+	query, err := internal.BuildQuery(elasticsearch_db.query_by, q)
+
+	if err != nil {
+		return fmt.Errorf("Failed to build query, %w", err)
+	}
+
+	pit_id, err := elasticsearch_db.openPointInTime(ctx)
+
+	if err != nil {
+		elasticsearch_db.logger.Printf("Failed to open point-in-time, falling back to scroll API: %v", err)
+		return elasticsearch_db.iterateWithScroll(ctx, query, fn)
+	}
+
+	defer elasticsearch_db.closePointInTime(ctx, pit_id)
+
+	return elasticsearch_db.iterateWithSearchAfter(ctx, query, pit_id, fn)
+}
+
+func (elasticsearch_db *ElasticsearchV7Database) openPointInTime(ctx context.Context) (string, error) {
+
+	req := esapi.OpenPointInTimeRequest{
+		Index:     []string{elasticsearch_db.index},
+		KeepAlive: iterate_keep_alive,
+	}
+
+	rsp, err := req.Do(ctx, elasticsearch_db.client)
+
+	if err != nil {
+		return "", fmt.Errorf("Failed to open point-in-time, %w", err)
+	}
+
+	defer rsp.Body.Close()
+
+	if rsp.IsError() {
+		return "", fmt.Errorf("Open point-in-time request failed with response: %s", rsp.Status())
+	}
+
+	var pit_rsp struct {
+		ID string `json:"id"`
+	}
+
+	dec := json.NewDecoder(rsp.Body)
+	err = dec.Decode(&pit_rsp)
+
+	if err != nil {
+		return "", fmt.Errorf("Failed to decode point-in-time response, %w", err)
+	}
+
+	return pit_rsp.ID, nil
+}
+
+func (elasticsearch_db *ElasticsearchV7Database) closePointInTime(ctx context.Context, pit_id string) {
+
+	body := map[string]any{
+		"id": pit_id,
+	}
+
+	enc_body, err := json.Marshal(body)
+
+	if err != nil {
+		elasticsearch_db.logger.Printf("Failed to marshal close point-in-time body, %v", err)
+		return
+	}
+
+	req := esapi.ClosePointInTimeRequest{
+		Body: bytes.NewReader(enc_body),
+	}
+
+	rsp, err := req.Do(ctx, elasticsearch_db.client)
+
+	if err != nil {
+		elasticsearch_db.logger.Printf("Failed to close point-in-time, %v", err)
+		return
+	}
+
+	rsp.Body.Close()
+}
+
+func (elasticsearch_db *ElasticsearchV7Database) iterateWithSearchAfter(ctx context.Context, query map[string]any, pit_id string, fn func(*database.QueryResult) error) error {
+
+	var search_after []any
+
+	for {
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+			// pass
+		}
+
+		body := map[string]any{
+			"size":  iterate_page_size,
+			"query": query,
+			"pit": map[string]any{
+				"id":         pit_id,
+				"keep_alive": iterate_keep_alive,
+			},
+			"sort": []any{
+				map[string]any{"_shard_doc": "asc"},
+			},
+		}
+
+		if search_after != nil {
+			body["search_after"] = search_after
+		}
+
+		enc_body, err := json.Marshal(body)
+
+		if err != nil {
+			return fmt.Errorf("Failed to marshal search-after query, %w", err)
+		}
+
+		req := esapi.SearchRequest{
+			Body: bytes.NewReader(enc_body),
+		}
+
+		rsp, err := req.Do(ctx, elasticsearch_db.client)
+
+		if err != nil {
+			return fmt.Errorf("Failed to perform search-after query, %w", err)
+		}
+
+		if rsp.IsError() {
+			rsp.Body.Close()
+			return fmt.Errorf("Search-after request failed with response: %s", rsp.Status())
+		}
+
+		query_rsp, err := internal.DecodeQueryResponse(rsp.Body)
+		rsp.Body.Close()
+
+		if err != nil {
+			return fmt.Errorf("Failed to decode search-after response, %w", err)
+		}
+
+		if len(query_rsp.Hits.Results) == 0 {
+			return nil
+		}
+
+		for _, r := range query_rsp.Hits.Results {
+
+			err := fn(r.Result)
+
+			if err != nil {
+				return fmt.Errorf("Callback failed, %w", err)
+			}
+
+			search_after = r.Sort
+		}
+	}
+}
+
+func (elasticsearch_db *ElasticsearchV7Database) iterateWithScroll(ctx context.Context, query map[string]any, fn func(*database.QueryResult) error) error {
+
+	body := map[string]any{
+		"size":  iterate_page_size,
+		"query": query,
+	}
+
+	enc_body, err := json.Marshal(body)
+
+	if err != nil {
+		return fmt.Errorf("Failed to marshal scroll query, %w", err)
+	}
+
+	req := esapi.SearchRequest{
+		Index: []string{
+			elasticsearch_db.index,
+		},
+		Body:   bytes.NewReader(enc_body),
+		Scroll: parseKeepAlive(iterate_keep_alive),
+	}
+
+	rsp, err := req.Do(ctx, elasticsearch_db.client)
+
+	if err != nil {
+		return fmt.Errorf("Failed to perform initial scroll query, %w", err)
+	}
+
+	if rsp.IsError() {
+		rsp.Body.Close()
+		return fmt.Errorf("Initial scroll request failed with response: %s", rsp.Status())
+	}
+
+	query_rsp, err := internal.DecodeQueryResponse(rsp.Body)
+	rsp.Body.Close()
+
+	if err != nil {
+		return fmt.Errorf("Failed to decode initial scroll response, %w", err)
+	}
+
+	scroll_id := query_rsp.ScrollID
+
+	defer elasticsearch_db.clearScroll(context.Background(), scroll_id)
+
+	for {
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+			// pass
+		}
+
+		if len(query_rsp.Hits.Results) == 0 {
+			return nil
+		}
+
+		for _, r := range query_rsp.Hits.Results {
+
+			err := fn(r.Result)
+
+			if err != nil {
+				return fmt.Errorf("Callback failed, %w", err)
+			}
+		}
+
+		scroll_req := esapi.ScrollRequest{
+			ScrollID: scroll_id,
+			Scroll:   parseKeepAlive(iterate_keep_alive),
+		}
+
+		scroll_rsp, err := scroll_req.Do(ctx, elasticsearch_db.client)
+
+		if err != nil {
+			return fmt.Errorf("Failed to perform scroll request, %w", err)
+		}
+
+		query_rsp, err = internal.DecodeQueryResponse(scroll_rsp.Body)
+		scroll_rsp.Body.Close()
+
+		if err != nil {
+			return fmt.Errorf("Failed to decode scroll response, %w", err)
+		}
+
+		scroll_id = query_rsp.ScrollID
+	}
+}
+
+func (elasticsearch_db *ElasticsearchV7Database) clearScroll(ctx context.Context, scroll_id string) {
+
+	if scroll_id == "" {
+		return
+	}
+
+	req := esapi.ClearScrollRequest{
+		ScrollID: []string{scroll_id},
+	}
+
+	rsp, err := req.Do(ctx, elasticsearch_db.client)
+
+	if err != nil {
+		elasticsearch_db.logger.Printf("Failed to clear scroll, %v", err)
+		return
+	}
+
+	rsp.Body.Close()
+}
+
+func parseKeepAlive(keep_alive string) time.Duration {
+
+	d, err := time.ParseDuration(keep_alive)
+
+	if err != nil {
+		return time.Minute
+	}
+
+	return d
+}